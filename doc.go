@@ -2,7 +2,7 @@
 Package cors is a handler for the core (https://godoc.org/github.com/volatile/core).
 It provides Cross-Origin Resource Sharing support.
 
-Usage
+# Usage
 
 When using CORS (globally or locally), there is always a parameter of type OriginsMap.
 It can contain a map of allowed origins and their specific options.
@@ -26,7 +26,7 @@ Use AllOrigins to set options for all origins.
 		},
 	})
 
-Global usage
+# Global usage
 
 Use sets a global CORS configuration for all the handlers downstream:
 
@@ -55,20 +55,98 @@ Use sets a global CORS configuration for all the handlers downstream:
 
 Make sure to include the handler above any other handler that alter the response body.
 
-Local usage
+# Origin patterns
+
+Besides exact origin strings, OriginsMap keys can be wildcard patterns or,
+prefixed with "~", regular expressions:
+
+	cors.Use(&cors.OriginsMap{
+		"*.example.com":      nil,
+		"~^https://(foo|bar)\\.dev$": nil,
+	})
+
+Since OriginsMap is a plain Go map, it has no real insertion order, so when
+an origin could satisfy more than one pattern (such as overlapping
+"*.example.com" and "*.internal.example.com" entries), the one that wins is
+whichever sorts first by key, not whichever was written first. Avoid
+registering overlapping patterns for the same OriginsMap if which one wins
+matters to you.
+
+For policies that can't be expressed as a static map (looking up an allowed
+origin from a database, for example), pass an AllowOriginFunc instead:
+
+	cors.Use(cors.AllowOriginFunc(func(origin string) (*cors.Options, bool) {
+		return lookupOrigin(origin)
+	}))
+
+# Preflight requests
+
+By default, a preflight (OPTIONS) request is short-circuited: it never reaches
+the downstream handler and responds with OptionsSuccessStatus, which defaults
+to http.StatusNoContent (204). Set OptionsSuccessStatus to use a different
+status:
+
+	cors.Use(&cors.OriginsMap{
+		cors.AllOrigins: &cors.Options{
+			OptionsSuccessStatus: http.StatusOK,
+		},
+	})
+
+Or set OptionsPassthrough to forward the preflight to the downstream handler
+instead, for cases where another handler needs to observe it too. The CORS
+headers are still set, but OptionsSuccessStatus isn't used: the downstream
+handler writes the response.
+
+	cors.Use(&cors.OriginsMap{
+		cors.AllOrigins: &cors.Options{
+			OptionsPassthrough: true,
+		},
+	})
+
+A preflight requesting a method or header that isn't allowed gets a 403
+instead of having it echoed back.
+
+# Presets
+
+AllowAll, Default and Strict return ready-to-use OriginsMap values for
+common policies, so callers don't have to restate them:
+
+	cors.Use(cors.AllowAll())           // Wide open, e.g. a public S3-like API.
+	cors.Use(cors.Default())            // Safe, read-only public API.
+	cors.Use(cors.Strict("example.com", "*.example.com"))
+
+# Credentials and the wildcard
+
+Combining CredentialsAllowed with the AllOrigins wildcard lets any site make
+authenticated requests, so Use and LocalUse panic (and UseE/LocalUseE return
+an error) unless the matching Options also sets AllowCredentialsWithWildcard:
+
+	cors.Use(&cors.OriginsMap{
+		cors.AllOrigins: &cors.Options{
+			CredentialsAllowed:           true,
+			AllowCredentialsWithWildcard: true, // I know what I'm doing.
+		},
+	})
+
+# Local usage
 
 LocalUse sets CORS locally, inside a single handler.
 This setting takes precedence over he global CORS options (if set).
 
+Build the *OriginsMap once and reuse it across requests, so its policy is
+precomputed once instead of on every call:
+
+	var readOnlyOrigins = &cors.OriginsMap{
+		cors.AllOrigins: &cors.Options{AllowedMethods: []string{"GET"}},
+	}
+
 	core.Use(func(c *core.Context) {
-		cors.LocalUse(c, &cors.OriginsMap{
-			cors.AllOrigins: &cors.Options{AllowedMethods: []string{"GET"}},
-		}, func() {
+		cors.LocalUse(c, readOnlyOrigins, func() {
 			response.Status(c, http.StatusOK)
 		})
 	})
 
-Documentation
+# Documentation
 
 For more information:
 
@@ -13,8 +13,29 @@ import (
 const AllOrigins = "*"
 
 // OriginsMap represents the allowed origins with their respective options.
+//
+// Besides exact origin strings, keys may be wildcard patterns (e.g.
+// "*.example.com" or "https://*.foo.dev:*") or, prefixed with "~", regular
+// expressions (e.g. "~^https://[a-z0-9-]+\\.internal\\.corp$"). See
+// MatchOrigin for how a request's Origin header is resolved against these
+// entries.
 type OriginsMap map[string]*Options
 
+// OriginsMatcher resolves a request's Origin header to the *Options that
+// apply to it, and reports whether the origin is allowed at all.
+// *OriginsMap implements it for static configurations; AllowOriginFunc
+// adapts a plain function for dynamic policies, such as looking up allowed
+// origins from a database on a per-request basis.
+type OriginsMatcher interface {
+	MatchOrigin(origin string) (*Options, bool)
+}
+
+// AllowOriginFunc adapts a plain function to the OriginsMatcher interface.
+type AllowOriginFunc func(origin string) (*Options, bool)
+
+// MatchOrigin calls f.
+func (f AllowOriginFunc) MatchOrigin(origin string) (*Options, bool) { return f(origin) }
+
 // Options represents access control options for an origin.
 type Options struct {
 	AllowedHeaders     []string      // AllowedHeaders indicates, in the case of a preflight request, which headers can be used during the actual request. If none are set, all are allowed.
@@ -22,24 +43,115 @@ type Options struct {
 	CredentialsAllowed bool          // CredentialsAllowed indicates whether the request can include user credentials like cookies, HTTP authentication or client side SSL certificates.
 	ExposedHeaders     []string      // ExposedHeaders whitelists headers that browsers are allowed to access.
 	MaxAge             time.Duration // MaxAge indicates how long the results of a preflight request can be cached.
+
+	// OptionsSuccessStatus is the status code sent for a successful preflight
+	// request. It defaults to http.StatusNoContent (204). It isn't used when
+	// OptionsPassthrough is set.
+	OptionsSuccessStatus int
+
+	// OptionsPassthrough lets preflight requests reach the downstream
+	// handler instead of being short-circuited, for cases where another
+	// handler downstream needs to observe them too. The CORS headers are
+	// still set beforehand.
+	OptionsPassthrough bool
+
+	// AllowPrivateNetwork indicates whether a preflight carrying
+	// Access-Control-Request-Private-Network: true is allowed to reach a
+	// private network (LAN or loopback) target, per the Private Network
+	// Access spec. If false, such preflights are rejected.
+	AllowPrivateNetwork bool
+
+	// AllowCredentialsWithWildcard must be set to confirm that combining
+	// CredentialsAllowed with the AllOrigins wildcard is intentional: it
+	// lets any site make authenticated requests. Use/UseE reject that
+	// combination otherwise.
+	AllowCredentialsWithWildcard bool
 }
 
 // Use adds a handler to the default handlers stack.
-// It sets a global CORS configuration for all the handlers downstream.
-func Use(origins *OriginsMap) {
+// It sets a CORS configuration for all the handlers registered downstream
+// from this call.
+//
+// origins may be a *OriginsMap, an AllowOriginFunc, any other OriginsMatcher,
+// or nil to allow all origins. The resolved policy is precomputed once here
+// and captured by the registered handler, so calling Use again only affects
+// handlers registered after that call, as described above.
+//
+// Use panics if origins is invalid; see UseE for a variant that returns the
+// error instead.
+func Use(origins OriginsMatcher) {
+	if err := UseE(origins); err != nil {
+		panic(err)
+	}
+}
+
+// UseE is like Use, but returns an error instead of panicking when origins
+// combines the AllOrigins wildcard with CredentialsAllowed without also
+// setting AllowCredentialsWithWildcard, or contains a pattern key that fails
+// to compile.
+func UseE(origins OriginsMatcher) error {
+	if err := validateOrigins(origins); err != nil {
+		return err
+	}
+	if err := validatePatterns(origins); err != nil {
+		return err
+	}
+	p := newPolicy(origins)
 	core.Use(func(c *core.Context) {
-		setCORS(c, origins, c.Next)
+		setCORS(c, p, c.Next)
 	})
+	return nil
+}
+
+// validateOrigins rejects the credentialed-wildcard footgun: CredentialsAllowed
+// combined with the AllOrigins wildcard lets any site make authenticated
+// requests, unless the caller explicitly confirms that's intended.
+func validateOrigins(origins OriginsMatcher) error {
+	om, ok := origins.(*OriginsMap)
+	if !ok || om == nil {
+		return nil
+	}
+	opts, ok := (*om)[AllOrigins]
+	if !ok || opts == nil || !opts.CredentialsAllowed || opts.AllowCredentialsWithWildcard {
+		return nil
+	}
+	return fmt.Errorf("cors: origin %q allows credentials; set AllowCredentialsWithWildcard to confirm this is intentional", AllOrigins)
 }
 
 // LocalUse sets CORS locally, inside a single handler.
 // This setting takes precedence over he global CORS options (if set).
-func LocalUse(c *core.Context, origins *OriginsMap, handler func()) {
-	setCORS(c, origins, handler)
+//
+// When origins is an *OriginsMap, its policy is precomputed once and cached
+// by the map's address, so calling LocalUse with the same *OriginsMap on
+// every request (as shown in the package documentation) doesn't rebuild it
+// each time.
+//
+// LocalUse panics if origins is invalid; see LocalUseE for a variant that
+// returns the error instead.
+func LocalUse(c *core.Context, origins OriginsMatcher, handler func()) {
+	if err := LocalUseE(c, origins, handler); err != nil {
+		panic(err)
+	}
+}
+
+// LocalUseE is like LocalUse, but returns an error instead of panicking when
+// origins combines the AllOrigins wildcard with CredentialsAllowed without
+// also setting AllowCredentialsWithWildcard, or contains a pattern key that
+// fails to compile.
+func LocalUseE(c *core.Context, origins OriginsMatcher, handler func()) error {
+	if err := validateOrigins(origins); err != nil {
+		return err
+	}
+	if err := validatePatterns(origins); err != nil {
+		return err
+	}
+	setCORS(c, localPolicy(origins), handler)
+	return nil
 }
 
 // setCORS sets the response headers and continues downstream if it's not a preflight request.
-func setCORS(c *core.Context, origins *OriginsMap, handler func()) {
+// A preflight request continues downstream too when its options set OptionsPassthrough.
+func setCORS(c *core.Context, p *policy, handler func()) {
 	origin := c.Request.Header.Get("Origin")
 
 	// Don't use CORS without an origin.
@@ -48,61 +160,99 @@ func setCORS(c *core.Context, origins *OriginsMap, handler func()) {
 		return
 	}
 
-	if origins == nil || len(*origins) == 0 {
-		origins = &OriginsMap{AllOrigins: nil}
+	ro, allowed := p.match(origin)
+
+	// If the origin isn't allowed, reject the request.
+	if !allowed {
+		http.Error(c.ResponseWriter, "Forbidden CORS request", http.StatusForbidden)
+		return
 	}
 
-	opts, knownOrigin := (*origins)[origin]
+	h := c.ResponseWriter.Header()
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Add("Vary", "Origin")
 
-	// If origin is unknown, see for wildcard.
-	var allOriginsAllowed bool
-	if !knownOrigin {
-		opts, allOriginsAllowed = (*origins)[AllOrigins]
+	if ro.allowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if ro.exposedHeaders != "" {
+		h.Set("Access-Control-Expose-Headers", ro.exposedHeaders)
+	}
+	if ro.maxAge != "" {
+		h.Set("Access-Control-Max-Age", ro.maxAge)
 	}
 
-	// If origin is unknown and wildcard isn't set, reject the request.
-	if !knownOrigin && !allOriginsAllowed {
-		http.Error(c.ResponseWriter, "Forbidden CORS request", http.StatusForbidden)
+	// OPTIONS method is used for a preflight request. It must be short-circuited before it
+	// reaches a handler that could write to the response body, unless OptionsPassthrough is set.
+	if c.Request.Method != "OPTIONS" {
+		handler()
 		return
 	}
 
-	c.ResponseWriter.Header().Set("Access-Control-Allow-Origin", origin)
-	c.ResponseWriter.Header().Set("Vary", "Origin")
+	// Preflight responses can be cached keyed on the requested method/headers too, so they must vary on them as well.
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	reqMethod := c.Request.Header.Get("Access-Control-Request-Method")
+	reqHeaders := splitHeaderList(c.Request.Header.Get("Access-Control-Request-Headers"))
 
-	// Set credentials header only if they are allowed.
-	if opts != nil && opts.CredentialsAllowed {
-		c.ResponseWriter.Header().Set("Access-Control-Allow-Credentials", "true")
+	// Reject the preflight rather than blindly echoing back a method or headers that aren't allowed.
+	if ro.allowedMethodsSet != nil && reqMethod != "" && !ro.allowedMethodsSet[strings.ToLower(reqMethod)] {
+		http.Error(c.ResponseWriter, "Forbidden CORS request", http.StatusForbidden)
+		return
+	}
+	if ro.allowedHeadersSet != nil {
+		for _, reqHeader := range reqHeaders {
+			if !ro.allowedHeadersSet[strings.ToLower(reqHeader)] {
+				http.Error(c.ResponseWriter, "Forbidden CORS request", http.StatusForbidden)
+				return
+			}
+		}
 	}
 
-	if opts != nil && len(opts.ExposedHeaders) > 0 {
-		c.ResponseWriter.Header().Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+	// Private Network Access: a preflight targeting a private network must be explicitly allowed.
+	if c.Request.Header.Get("Access-Control-Request-Private-Network") == "true" {
+		if !ro.allowPrivateNetwork {
+			http.Error(c.ResponseWriter, "Forbidden CORS request", http.StatusForbidden)
+			return
+		}
+		h.Set("Access-Control-Allow-Private-Network", "true")
 	}
 
-	if opts != nil && opts.MaxAge != 0 {
-		c.ResponseWriter.Header().Set("Access-Control-Max-Age", fmt.Sprintf("%.f", opts.MaxAge.Seconds()))
+	// If no allowed headers are set, all requested ones are allowed.
+	if ro.allowedHeaders != "" {
+		h.Set("Access-Control-Allow-Headers", ro.allowedHeaders)
+	} else if len(reqHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
 	}
 
-	// OPTIONS method is used for a preflight request.
-	// In this case, other CORS headers still need to be set before sending all of them, without any other work downstream.
-	if c.Request.Method != "OPTIONS" {
+	// If no allowed methods are set, the requested one is allowed.
+	if ro.allowedMethods != "" {
+		h.Set("Access-Control-Allow-Methods", ro.allowedMethods)
+	} else if reqMethod != "" {
+		h.Set("Access-Control-Allow-Methods", reqMethod)
+	}
+
+	if ro.optionsPassthrough {
 		handler()
 		return
 	}
 
-	// If no allowed headers are set, all are allowed.
-	if opts != nil && len(opts.AllowedHeaders) > 0 {
-		c.ResponseWriter.Header().Set("Access-Control-Allow-Headers", strings.Join(opts.AllowedHeaders, ", "))
-	} else {
-		c.ResponseWriter.Header().Set("Access-Control-Allow-Headers", c.Request.Header.Get("Access-Control-Request-Headers"))
-	}
+	c.ResponseWriter.WriteHeader(ro.optionsSuccessStatus)
+}
 
-	// If no allowed methods are set, all are allowed.
-	if opts != nil && len(opts.AllowedHeaders) > 0 {
-		c.ResponseWriter.Header().Set("Access-Control-Allow-Methods", strings.Join(opts.AllowedMethods, ", "))
-	} else {
-		c.ResponseWriter.Header().Set("Access-Control-Allow-Methods", c.Request.Header.Get("Access-Control-Request-Method"))
+// splitHeaderList splits a comma-separated header list (such as
+// Access-Control-Request-Headers) into its trimmed, non-empty values.
+func splitHeaderList(s string) []string {
+	if s == "" {
+		return nil
 	}
-
-	// It was a preflight request so we just send the headers.
-	c.ResponseWriter.WriteHeader(http.StatusOK)
+	parts := strings.Split(s, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
 }
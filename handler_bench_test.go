@@ -0,0 +1,69 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/volatile/core"
+)
+
+var benchOrigins = &OriginsMap{
+	"https://example.com": {
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		ExposedHeaders: []string{"X-Request-Id"},
+		MaxAge:         10 * time.Minute,
+	},
+}
+
+func benchContext(method string) *core.Context {
+	r := httptest.NewRequest(method, "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+	if method == http.MethodOptions {
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		r.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	}
+	return &core.Context{ResponseWriter: httptest.NewRecorder(), Request: r}
+}
+
+func BenchmarkPreflight(b *testing.B) {
+	p := newPolicy(benchOrigins)
+	c := benchContext(http.MethodOptions)
+	noop := func() {}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		setCORS(c, p, noop)
+	}
+}
+
+func BenchmarkActualRequest(b *testing.B) {
+	p := newPolicy(benchOrigins)
+	c := benchContext(http.MethodGet)
+	noop := func() {}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		setCORS(c, p, noop)
+	}
+}
+
+// BenchmarkLocalUse exercises LocalUseE as it's meant to be called: with the
+// same *OriginsMap on every request, so it hits the cached policy instead of
+// rebuilding one each time.
+func BenchmarkLocalUse(b *testing.B) {
+	c := benchContext(http.MethodOptions)
+	noop := func() {}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := LocalUseE(c, benchOrigins, noop); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/volatile/core"
+)
+
+// newTestContext builds a *core.Context for method/origin, applying any
+// extra request headers, backed by an httptest.ResponseRecorder.
+func newTestContext(method, origin string, extraHeaders map[string]string) (*core.Context, *httptest.ResponseRecorder) {
+	r := httptest.NewRequest(method, "/", nil)
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	for k, v := range extraHeaders {
+		r.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	return &core.Context{ResponseWriter: rec, Request: r}, rec
+}
+
+func TestSetCORSActualRequest(t *testing.T) {
+	p := newPolicy(&OriginsMap{
+		"https://example.com": {
+			ExposedHeaders: []string{"X-Request-Id"},
+		},
+	})
+	c, rec := newTestContext(http.MethodGet, "https://example.com", nil)
+
+	called := false
+	setCORS(c, p, func() { called = true })
+
+	if !called {
+		t.Error("handler wasn't called for a non-preflight request")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the exact origin", got)
+	}
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-Id" {
+		t.Errorf("Access-Control-Expose-Headers = %q, want %q", got, "X-Request-Id")
+	}
+}
+
+func TestSetCORSUnknownOriginRejected(t *testing.T) {
+	p := newPolicy(&OriginsMap{"https://example.com": nil})
+	c, rec := newTestContext(http.MethodGet, "https://evil.com", nil)
+
+	called := false
+	setCORS(c, p, func() { called = true })
+
+	if called {
+		t.Error("handler was called for a rejected origin")
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestSetCORSPreflightDefaultStatus(t *testing.T) {
+	p := newPolicy(&OriginsMap{
+		"https://example.com": {AllowedMethods: []string{"GET"}},
+	})
+	c, rec := newTestContext(http.MethodOptions, "https://example.com", map[string]string{
+		"Access-Control-Request-Method": "GET",
+	})
+
+	called := false
+	setCORS(c, p, func() { called = true })
+
+	if called {
+		t.Error("handler was called for a preflight request without OptionsPassthrough")
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+}
+
+func TestSetCORSPreflightCustomStatus(t *testing.T) {
+	p := newPolicy(&OriginsMap{
+		"https://example.com": {OptionsSuccessStatus: http.StatusOK},
+	})
+	c, rec := newTestContext(http.MethodOptions, "https://example.com", nil)
+
+	setCORS(c, p, func() {})
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestSetCORSPreflightPassthrough(t *testing.T) {
+	p := newPolicy(&OriginsMap{
+		"https://example.com": {OptionsPassthrough: true},
+	})
+	c, _ := newTestContext(http.MethodOptions, "https://example.com", nil)
+
+	called := false
+	setCORS(c, p, func() { called = true })
+
+	if !called {
+		t.Error("handler wasn't called for a preflight request with OptionsPassthrough")
+	}
+}
+
+func TestSetCORSPreflightRejectsDisallowedMethod(t *testing.T) {
+	p := newPolicy(&OriginsMap{
+		"https://example.com": {AllowedMethods: []string{"GET"}},
+	})
+	c, rec := newTestContext(http.MethodOptions, "https://example.com", map[string]string{
+		"Access-Control-Request-Method": "DELETE",
+	})
+
+	setCORS(c, p, func() {})
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d for a disallowed requested method", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestSetCORSPreflightRejectsDisallowedHeader(t *testing.T) {
+	p := newPolicy(&OriginsMap{
+		"https://example.com": {AllowedHeaders: []string{"Content-Type"}},
+	})
+	c, rec := newTestContext(http.MethodOptions, "https://example.com", map[string]string{
+		"Access-Control-Request-Headers": "X-Secret",
+	})
+
+	setCORS(c, p, func() {})
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d for a disallowed requested header", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestSetCORSPreflightAllowsPrivateNetwork(t *testing.T) {
+	p := newPolicy(&OriginsMap{
+		"https://example.com": {AllowPrivateNetwork: true},
+	})
+	c, rec := newTestContext(http.MethodOptions, "https://example.com", map[string]string{
+		"Access-Control-Request-Private-Network": "true",
+	})
+
+	setCORS(c, p, func() {})
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d; AllowPrivateNetwork should let the preflight through", rec.Code, http.StatusNoContent)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Private-Network"); got != "true" {
+		t.Errorf("Access-Control-Allow-Private-Network = %q, want %q", got, "true")
+	}
+}
+
+func TestSetCORSPreflightRejectsPrivateNetworkWithoutOptIn(t *testing.T) {
+	p := newPolicy(&OriginsMap{"https://example.com": nil})
+	c, rec := newTestContext(http.MethodOptions, "https://example.com", map[string]string{
+		"Access-Control-Request-Private-Network": "true",
+	})
+
+	setCORS(c, p, func() {})
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d for a private-network preflight without AllowPrivateNetwork", rec.Code, http.StatusForbidden)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Private-Network"); got != "" {
+		t.Errorf("Access-Control-Allow-Private-Network = %q, want unset", got)
+	}
+}
+
+// Regression test: Access-Control-Allow-Methods used to be gated on
+// len(AllowedHeaders) instead of len(AllowedMethods).
+func TestSetCORSAllowedMethodsHeaderSetWithoutAllowedHeaders(t *testing.T) {
+	p := newPolicy(&OriginsMap{
+		"https://example.com": {AllowedMethods: []string{"GET", "POST"}},
+	})
+	c, rec := newTestContext(http.MethodOptions, "https://example.com", map[string]string{
+		"Access-Control-Request-Method": "GET",
+	})
+
+	setCORS(c, p, func() {})
+
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+		t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, "GET, POST")
+	}
+}
+
+// Regression test: AllowAll's AllowedHeaders: []string{"*"} must allow any
+// requested header, not just one literally named "*".
+func TestSetCORSAllowAllAcceptsRealPreflight(t *testing.T) {
+	p := newPolicy(AllowAll())
+	c, rec := newTestContext(http.MethodOptions, "https://example.com", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "Content-Type, Authorization",
+	})
+
+	setCORS(c, p, func() {})
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d; AllowAll() must not reject a real preflight", rec.Code, http.StatusNoContent)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, Authorization" {
+		t.Errorf("Access-Control-Allow-Headers = %q, want the requested headers echoed back", got)
+	}
+	// AllowedMethods is AllowAll's explicit method list, not a wildcard, so
+	// it's sent in full rather than echoing back the requested method.
+	const wantMethods = "GET, POST, PUT, DELETE, HEAD, OPTIONS, PATCH"
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != wantMethods {
+		t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, wantMethods)
+	}
+}
+
+// Regression test: LocalUse/LocalUseE used to skip the credentialed-wildcard
+// validation that Use/UseE enforce, silently allowing the footgun doc.go
+// says is rejected unless AllowCredentialsWithWildcard is set.
+func TestLocalUseERejectsCredentialedWildcard(t *testing.T) {
+	c, _ := newTestContext(http.MethodGet, "https://example.com", nil)
+
+	err := LocalUseE(c, &OriginsMap{
+		AllOrigins: {CredentialsAllowed: true},
+	}, func() {})
+
+	if err == nil {
+		t.Fatal("LocalUseE didn't reject a credentialed AllOrigins wildcard")
+	}
+}
+
+// Regression test: an invalid pattern key used to be silently dropped,
+// rejecting legitimate origins with no diagnostics. LocalUseE (like UseE)
+// must surface it as an error instead.
+func TestLocalUseERejectsInvalidPattern(t *testing.T) {
+	c, _ := newTestContext(http.MethodGet, "https://example.com", nil)
+
+	err := LocalUseE(c, &OriginsMap{`~^https://(unclosed`: nil}, func() {})
+
+	if err == nil {
+		t.Fatal("LocalUseE didn't reject an invalid origin pattern")
+	}
+}
+
+// Regression test: UseE used to store every call's policy in one shared,
+// mutable package-level pointer, so a later, looser UseE call retroactively
+// relaxed the origin restriction for handlers registered by an earlier,
+// stricter call. It also broke the "Global usage" example in doc.go the other
+// way round: the later, GET-only policy replaced the permissive one in front
+// of the root-path handler. UseE must instead capture each call's policy in
+// the closure it registers.
+func TestUseCapturesPolicyAtRegistrationTime(t *testing.T) {
+	if err := UseE(&OriginsMap{"https://allowed.com": nil}); err != nil {
+		t.Fatal(err)
+	}
+	if err := UseE(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://evil.com")
+	rec := httptest.NewRecorder()
+	core.Serve(rec, r)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d; the first, stricter UseE call's policy should still govern its handler", rec.Code, http.StatusForbidden)
+	}
+}
+
+// Regression test: LocalUse used to call newPolicy on every invocation,
+// recompiling every pattern and rejoining every header on every request.
+// localPolicy must instead cache and reuse the policy for a given
+// *OriginsMap.
+func TestLocalPolicyCachesByOriginsMap(t *testing.T) {
+	om := &OriginsMap{"https://example.com": {AllowedMethods: []string{"GET"}}}
+
+	p1 := localPolicy(om)
+	p2 := localPolicy(om)
+
+	if p1 != p2 {
+		t.Error("localPolicy rebuilt the policy for the same *OriginsMap instead of reusing the cached one")
+	}
+}
+
+// Regression test: localPolicyCache grew without bound, so a caller who
+// (against the documented build-once pattern) constructs a fresh
+// *OriginsMap per call leaked an entry, and its whole precomputed policy,
+// for the life of the process. localPolicy must cap the cache instead of
+// growing it forever.
+func TestLocalPolicyCacheIsBounded(t *testing.T) {
+	for i := 0; i < localPolicyCacheLimit+10; i++ {
+		localPolicy(&OriginsMap{"https://example.com": nil})
+	}
+
+	localPolicyMu.Lock()
+	size := len(localPolicyCache)
+	localPolicyMu.Unlock()
+
+	if size > localPolicyCacheLimit {
+		t.Errorf("localPolicyCache grew to %d entries, want at most %d", size, localPolicyCacheLimit)
+	}
+}
+
+// Regression test: filling the cache used to wipe every existing entry
+// instead of just refusing new ones, so a long-lived *OriginsMap that was
+// cached before the cache filled up would suddenly start paying a full
+// rebuild again. A *OriginsMap cached before the cache fills up must keep
+// being served from cache afterwards.
+func TestLocalPolicyCacheKeepsEntriesCachedBeforeItFilledUp(t *testing.T) {
+	// Other tests may have already filled the shared cache; start from a
+	// known-empty state so this test doesn't depend on run order.
+	localPolicyMu.Lock()
+	localPolicyCache = make(map[*OriginsMap]*policy)
+	localPolicyMu.Unlock()
+
+	om := &OriginsMap{"https://example.com": {AllowedMethods: []string{"GET"}}}
+	p := localPolicy(om)
+
+	for i := 0; i < localPolicyCacheLimit+10; i++ {
+		localPolicy(&OriginsMap{"https://example.com": nil})
+	}
+
+	if got := localPolicy(om); got != p {
+		t.Error("localPolicy rebuilt a policy that was cached before the cache filled up")
+	}
+}
+
+// Regression test: LocalUse/LocalUseE used to panic when passed a typed nil
+// *OriginsMap, because localPolicy unconditionally registered a finalizer on
+// it; a nil *OriginsMap is documented to mean "allow all" and must work.
+func TestLocalPolicyAcceptsNilOriginsMap(t *testing.T) {
+	var om *OriginsMap
+	if p := localPolicy(om); p == nil {
+		t.Fatal("localPolicy returned nil for a nil *OriginsMap")
+	}
+}
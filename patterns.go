@@ -0,0 +1,118 @@
+package cors
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var _ OriginsMatcher = (*OriginsMap)(nil)
+
+// compiledPattern is a pre-compiled origin pattern, built from an OriginsMap
+// key that isn't an exact origin string.
+type compiledPattern struct {
+	opts *Options
+	re   *regexp.Regexp
+}
+
+// isPattern reports whether key should be matched as a wildcard or regular
+// expression instead of as an exact origin string.
+func isPattern(key string) bool {
+	return key != AllOrigins && (strings.HasPrefix(key, "~") || strings.Contains(key, "*"))
+}
+
+// compilePattern turns a pattern key into a regular expression.
+//
+// A key prefixed with "~" is used as-is, minus the prefix, as a regular
+// expression; it is anchored only if it includes "^" and "$" itself, so an
+// unanchored one matches any origin containing a match. Any other key is treated as a glob: "*" is translated to ".*"
+// and everything else is escaped, and the result is anchored to match a whole
+// origin string, so "*.example.com" matches
+// "https://foo.example.com" but "https://*.foo.dev:*" also matches a
+// trailing port.
+func compilePattern(key string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(key, "~") {
+		return regexp.Compile(key[1:])
+	}
+
+	parts := strings.Split(key, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return regexp.Compile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// patterns returns m's pattern entries, compiled and sorted by key.
+//
+// Go doesn't preserve the insertion order of map literals, so patterns are
+// matched in lexicographic key order instead: this keeps matching
+// deterministic when an origin could satisfy more than one pattern.
+//
+// A key whose regex fails to compile is silently skipped here: this method
+// backs MatchOrigin, which implements OriginsMatcher and so has no way to
+// report an error. validatePatterns is what actually surfaces a bad pattern,
+// via UseE/LocalUseE, before a policy is ever built from it.
+func (m OriginsMap) patterns() []compiledPattern {
+	var keys []string
+	for k := range m {
+		if isPattern(k) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+
+	out := make([]compiledPattern, 0, len(keys))
+	for _, k := range keys {
+		re, err := compilePattern(k)
+		if err != nil {
+			continue
+		}
+		out = append(out, compiledPattern{opts: m[k], re: re})
+	}
+	return out
+}
+
+// validatePatterns reports the first pattern key in origins that fails to
+// compile, so a typo'd pattern is rejected up front by UseE/LocalUseE
+// instead of silently matching nothing at request time.
+func validatePatterns(origins OriginsMatcher) error {
+	om, ok := origins.(*OriginsMap)
+	if !ok || om == nil {
+		return nil
+	}
+	for k := range *om {
+		if !isPattern(k) {
+			continue
+		}
+		if _, err := compilePattern(k); err != nil {
+			return fmt.Errorf("cors: invalid origin pattern %q: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// MatchOrigin resolves origin to its *Options: first by exact match, then
+// against any registered wildcard or regex patterns, and finally against
+// AllOrigins. It implements OriginsMatcher.
+//
+// The receiver is a pointer so that only *OriginsMap, not a bare OriginsMap
+// value, satisfies OriginsMatcher: a caller who forgets the "&" would
+// otherwise compile cleanly into the dynamic-matcher path, silently
+// bypassing validateOrigins, validatePatterns and the precomputed policy
+// cache, all of which only recognize *OriginsMap.
+func (m *OriginsMap) MatchOrigin(origin string) (*Options, bool) {
+	if opts, ok := (*m)[origin]; ok {
+		return opts, true
+	}
+	for _, p := range m.patterns() {
+		if p.re.MatchString(origin) {
+			return p.opts, true
+		}
+	}
+	opts, ok := (*m)[AllOrigins]
+	return opts, ok
+}
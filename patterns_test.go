@@ -0,0 +1,110 @@
+package cors
+
+import "testing"
+
+func TestOriginsMapMatchOriginExact(t *testing.T) {
+	exact := &Options{AllowedMethods: []string{"GET"}}
+	m := OriginsMap{"https://example.com": exact}
+
+	opts, ok := m.MatchOrigin("https://example.com")
+	if !ok || opts != exact {
+		t.Fatalf("MatchOrigin(exact) = %v, %v; want %v, true", opts, ok, exact)
+	}
+
+	if _, ok := m.MatchOrigin("https://other.com"); ok {
+		t.Fatal("MatchOrigin matched an origin that isn't registered")
+	}
+}
+
+func TestOriginsMapMatchOriginWildcardPattern(t *testing.T) {
+	sub := &Options{AllowedMethods: []string{"GET"}}
+	m := OriginsMap{"*.example.com": sub}
+
+	opts, ok := m.MatchOrigin("https://foo.example.com")
+	if !ok || opts != sub {
+		t.Fatalf("MatchOrigin(wildcard) = %v, %v; want %v, true", opts, ok, sub)
+	}
+
+	if _, ok := m.MatchOrigin("https://example.com"); ok {
+		t.Fatal("MatchOrigin matched a bare domain against a subdomain-only wildcard")
+	}
+}
+
+func TestOriginsMapMatchOriginRegexPattern(t *testing.T) {
+	internal := &Options{AllowedMethods: []string{"GET"}}
+	m := OriginsMap{`~^https://[a-z0-9-]+\.internal\.corp$`: internal}
+
+	opts, ok := m.MatchOrigin("https://svc-1.internal.corp")
+	if !ok || opts != internal {
+		t.Fatalf("MatchOrigin(regex) = %v, %v; want %v, true", opts, ok, internal)
+	}
+
+	if _, ok := m.MatchOrigin("https://svc-1.internal.corp.evil.com"); ok {
+		t.Fatal("MatchOrigin matched an origin that only has the regex as a prefix")
+	}
+}
+
+func TestOriginsMapMatchOriginPrecedence(t *testing.T) {
+	exactOpts := &Options{AllowedMethods: []string{"GET"}}
+	wildcardOpts := &Options{AllowedMethods: []string{"POST"}}
+	allOpts := &Options{AllowedMethods: []string{"HEAD"}}
+	m := OriginsMap{
+		"https://foo.example.com": exactOpts,
+		"*.example.com":           wildcardOpts,
+		AllOrigins:                allOpts,
+	}
+
+	if opts, _ := m.MatchOrigin("https://foo.example.com"); opts != exactOpts {
+		t.Error("an exact match should win over a pattern match")
+	}
+	if opts, _ := m.MatchOrigin("https://bar.example.com"); opts != wildcardOpts {
+		t.Error("a pattern match should win over the AllOrigins fallback")
+	}
+	if opts, ok := m.MatchOrigin("https://unrelated.com"); !ok || opts != allOpts {
+		t.Error("an unmatched origin should fall back to AllOrigins")
+	}
+}
+
+func TestOriginsMapMatchOriginNoFallback(t *testing.T) {
+	m := OriginsMap{"https://example.com": nil}
+	if _, ok := m.MatchOrigin("https://other.com"); ok {
+		t.Fatal("MatchOrigin should reject an origin with no exact, pattern or AllOrigins match")
+	}
+}
+
+// Regression test: a pattern key whose regex fails to compile used to be
+// silently dropped by patterns(), with no way to find out why legitimate
+// origins stopped matching. validatePatterns must surface it instead.
+func TestValidatePatternsRejectsInvalidRegex(t *testing.T) {
+	m := &OriginsMap{`~^https://(unclosed`: nil}
+
+	if err := validatePatterns(m); err == nil {
+		t.Fatal("validatePatterns didn't reject an invalid regex pattern")
+	}
+}
+
+func TestValidatePatternsAcceptsValidPatterns(t *testing.T) {
+	m := &OriginsMap{
+		"*.example.com":                         nil,
+		`~^https://[a-z0-9-]+\.internal\.corp$`: nil,
+	}
+
+	if err := validatePatterns(m); err != nil {
+		t.Errorf("validatePatterns rejected valid patterns: %v", err)
+	}
+}
+
+func TestAllowOriginFunc(t *testing.T) {
+	opts := &Options{AllowedMethods: []string{"GET"}}
+	f := AllowOriginFunc(func(origin string) (*Options, bool) {
+		return opts, origin == "https://example.com"
+	})
+
+	var matcher OriginsMatcher = f
+	if got, ok := matcher.MatchOrigin("https://example.com"); !ok || got != opts {
+		t.Fatalf("MatchOrigin = %v, %v; want %v, true", got, ok, opts)
+	}
+	if _, ok := matcher.MatchOrigin("https://other.com"); ok {
+		t.Fatal("MatchOrigin should reject an origin the func rejects")
+	}
+}
@@ -0,0 +1,204 @@
+package cors
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// resolvedOptions is the precomputed, response-ready form of an *Options:
+// every string that setCORS would otherwise build with strings.Join,
+// fmt.Sprintf or time.Duration formatting on every request is computed once,
+// when the policy is built, instead.
+type resolvedOptions struct {
+	allowCredentials     bool
+	exposedHeaders       string          // pre-joined Access-Control-Expose-Headers; empty means unset
+	maxAge               string          // pre-formatted Access-Control-Max-Age; empty means unset
+	allowedHeaders       string          // pre-joined Access-Control-Allow-Headers; empty means echo the request
+	allowedHeadersSet    map[string]bool // lower-cased, for O(1) preflight validation; nil means all are allowed
+	allowedMethods       string          // pre-joined Access-Control-Allow-Methods; empty means echo the request
+	allowedMethodsSet    map[string]bool // lower-cased, for O(1) preflight validation; nil means all are allowed
+	optionsSuccessStatus int
+	optionsPassthrough   bool
+	allowPrivateNetwork  bool
+}
+
+// resolve precomputes opts into a resolvedOptions. opts may be nil, meaning
+// everything is allowed for that origin.
+func resolve(opts *Options) *resolvedOptions {
+	ro := &resolvedOptions{optionsSuccessStatus: http.StatusNoContent}
+	if opts == nil {
+		return ro
+	}
+
+	ro.allowCredentials = opts.CredentialsAllowed
+	ro.optionsPassthrough = opts.OptionsPassthrough
+	ro.allowPrivateNetwork = opts.AllowPrivateNetwork
+
+	if len(opts.ExposedHeaders) > 0 {
+		ro.exposedHeaders = strings.Join(opts.ExposedHeaders, ", ")
+	}
+	if opts.MaxAge != 0 {
+		ro.maxAge = strconv.FormatFloat(opts.MaxAge.Seconds(), 'f', 0, 64)
+	}
+	if len(opts.AllowedHeaders) > 0 && !isWildcardList(opts.AllowedHeaders) {
+		ro.allowedHeaders = strings.Join(opts.AllowedHeaders, ", ")
+		ro.allowedHeadersSet = lowerSet(opts.AllowedHeaders)
+	}
+	if len(opts.AllowedMethods) > 0 && !isWildcardList(opts.AllowedMethods) {
+		ro.allowedMethods = strings.Join(opts.AllowedMethods, ", ")
+		ro.allowedMethodsSet = lowerSet(opts.AllowedMethods)
+	}
+	if opts.OptionsSuccessStatus != 0 {
+		ro.optionsSuccessStatus = opts.OptionsSuccessStatus
+	}
+	return ro
+}
+
+// isWildcardList reports whether list is the single-entry wildcard ["*"],
+// meaning "allow any", rather than a literal allow-list containing one
+// value. Without this, AllowedHeaders/AllowedMethods: []string{"*"} would be
+// treated as only allowing a request header or method literally named "*".
+func isWildcardList(list []string) bool {
+	return len(list) == 1 && list[0] == "*"
+}
+
+// lowerSet builds a lower-cased lookup set, so preflight validation can
+// compare header/method names case-insensitively in O(1).
+func lowerSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, v := range list {
+		set[strings.ToLower(v)] = true
+	}
+	return set
+}
+
+// resolvedPattern is a compiled origin pattern paired with its precomputed options.
+type resolvedPattern struct {
+	re   *regexp.Regexp
+	opts *resolvedOptions
+}
+
+// policy is an immutable, precomputed snapshot of an OriginsMatcher. It's
+// built once by Use/LocalUse and then only ever read, so setCORS never races
+// with a rebuild: Use captures its *policy directly in the closure it
+// registers, and LocalUse serves one from localPolicyCache.
+type policy struct {
+	dynamic  bool // true when built from a matcher that isn't a *OriginsMap and can't be precomputed
+	matcher  OriginsMatcher
+	exact    map[string]*resolvedOptions
+	patterns []resolvedPattern
+	all      *resolvedOptions
+	hasAll   bool
+}
+
+// newPolicy builds a policy snapshot from origins.
+func newPolicy(origins OriginsMatcher) *policy {
+	if om, ok := origins.(*OriginsMap); ok && (om == nil || len(*om) == 0) {
+		origins = &OriginsMap{AllOrigins: nil}
+	} else if origins == nil {
+		origins = &OriginsMap{AllOrigins: nil}
+	}
+
+	om, ok := origins.(*OriginsMap)
+	if !ok {
+		return &policy{dynamic: true, matcher: origins}
+	}
+
+	p := &policy{exact: make(map[string]*resolvedOptions, len(*om))}
+	for k, v := range *om {
+		if isPattern(k) {
+			continue
+		}
+		p.exact[k] = resolve(v)
+	}
+	for _, cp := range om.patterns() {
+		p.patterns = append(p.patterns, resolvedPattern{re: cp.re, opts: resolve(cp.opts)})
+	}
+	if v, ok := (*om)[AllOrigins]; ok {
+		p.hasAll = true
+		p.all = resolve(v)
+	}
+	return p
+}
+
+// match resolves origin to its resolvedOptions: first by exact map lookup,
+// then against any patterns, and finally against AllOrigins.
+func (p *policy) match(origin string) (*resolvedOptions, bool) {
+	if p.dynamic {
+		opts, ok := p.matcher.MatchOrigin(origin)
+		if !ok {
+			return nil, false
+		}
+		return resolve(opts), true
+	}
+
+	if ro, ok := p.exact[origin]; ok {
+		return ro, true
+	}
+	for _, cp := range p.patterns {
+		if cp.re.MatchString(origin) {
+			return cp.opts, true
+		}
+	}
+	if p.hasAll {
+		return p.all, true
+	}
+	return nil, false
+}
+
+// localPolicyCacheLimit bounds localPolicyCache: a caller who (against the
+// documented build-once pattern) constructs a fresh *OriginsMap per call
+// would otherwise grow the cache, and the *OriginsMap values it keeps alive,
+// forever.
+const localPolicyCacheLimit = 4096
+
+// localPolicyCache backs LocalUse: it's keyed by *OriginsMap pointer, so a
+// handler that calls LocalUse with the same OriginsMap on every request (as
+// documented) only pays to precompute its policy once, instead of on every
+// request. Other OriginsMatcher implementations (such as AllowOriginFunc)
+// aren't cached: they're dynamic, and newPolicy doesn't precompute anything
+// for them.
+//
+// It's guarded by an RWMutex rather than a plain Mutex so that the common
+// case, a cache hit for a long-lived *OriginsMap, only ever takes the read
+// lock and can proceed concurrently across goroutines; the write lock is
+// only needed to insert a newly-seen *OriginsMap.
+var (
+	localPolicyMu    sync.RWMutex
+	localPolicyCache = make(map[*OriginsMap]*policy)
+)
+
+// localPolicy is like newPolicy, but serves a cached policy for a
+// previously-seen *OriginsMap instead of rebuilding it.
+func localPolicy(origins OriginsMatcher) *policy {
+	om, ok := origins.(*OriginsMap)
+	if !ok {
+		return newPolicy(origins)
+	}
+
+	localPolicyMu.RLock()
+	p, ok := localPolicyCache[om]
+	localPolicyMu.RUnlock()
+	if ok {
+		return p
+	}
+
+	p = newPolicy(origins)
+
+	localPolicyMu.Lock()
+	defer localPolicyMu.Unlock()
+	if cached, ok := localPolicyCache[om]; ok {
+		return cached
+	}
+	// Once the cache is full, stop admitting new entries instead of evicting
+	// existing ones: a caller following the documented build-once pattern
+	// keeps being served from cache, and one that builds a fresh *OriginsMap
+	// per call just doesn't benefit from caching beyond this point.
+	if len(localPolicyCache) < localPolicyCacheLimit {
+		localPolicyCache[om] = p
+	}
+	return p
+}
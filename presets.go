@@ -0,0 +1,39 @@
+package cors
+
+// AllowAll returns an OriginsMap that allows any origin, all standard
+// methods, any request header, and exposes a few commonly-needed response
+// headers, with credentials allowed. It's a convenience for exposing a
+// public, S3-like or JSON API to browsers with the fewest restrictions.
+func AllowAll() *OriginsMap {
+	return &OriginsMap{
+		AllOrigins: {
+			AllowedMethods:               []string{"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS", "PATCH"},
+			AllowedHeaders:               []string{"*"},
+			ExposedHeaders:               []string{"Content-Length", "Content-Type"},
+			CredentialsAllowed:           true,
+			AllowCredentialsWithWildcard: true,
+		},
+	}
+}
+
+// Default returns an OriginsMap suitable for a safe, read-only public API:
+// any origin may issue GET/HEAD (and OPTIONS) requests, but no credentials
+// are allowed and no other method is permitted.
+func Default() *OriginsMap {
+	return &OriginsMap{
+		AllOrigins: {
+			AllowedMethods: []string{"GET", "HEAD", "OPTIONS"},
+		},
+	}
+}
+
+// Strict returns an OriginsMap that only allows the given origins, with no
+// wildcard fallback and no credentials. Options for a specific origin can be
+// overridden on the returned map afterwards.
+func Strict(origins ...string) *OriginsMap {
+	m := make(OriginsMap, len(origins))
+	for _, o := range origins {
+		m[o] = nil
+	}
+	return &m
+}